@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"container/list"
 	"fmt"
 	"hash/fnv"
 	"runtime"
@@ -19,16 +20,23 @@ const (
 )
 
 type shardmap struct {
-	shards     []*lockMap
-	shardCount uint64
+	shards      []*lockMap
+	shardCount  uint64
+	maxPerShard int
+	policy      EvictionPolicy
 }
 
 type lockMap struct {
 	sync.RWMutex
-	m map[uint64]Item
+	m     map[uint64]Item
+	order *list.List               // LRU ordering; front is most recently used. nil unless policy is PolicyLRU.
+	elems map[uint64]*list.Element // key -> node in order, mirrors m
+	freq  map[uint64]int64         // access counters; nil unless policy is PolicyLFU.
+	calls map[uint64]*call         // in-flight GetOrSet loaders, keyed by hash
 }
 
 type Item struct {
+	Key        string
 	Object     interface{}
 	Expiration int64
 }
@@ -41,23 +49,114 @@ type Cache struct {
 type cache struct {
 	defaultExpiration time.Duration
 	shards            shardmap
+	options           Options
 	janitor           *janitor
 	Statistic         stats
+	onEvicted         func(string, interface{})
 }
 
 type stats struct {
 	ItemsCount, GetCount, SetCount, ReplaceCount, DeleteCount, AddCount, DeleteExpired int32
 }
 
-func newShardMap() shardmap {
-	count := uint64(10)
+// Options configures a cache's sharding behaviour. The zero value is not
+// valid on its own; use DefaultOptions() or NewWithOptions(), which fills in
+// any field left unset.
+type Options struct {
+	// ShardCount is the number of shards used to spread out lock
+	// contention. It is rounded up to the next power of two, so that
+	// GetShard can place keys with a bitmask instead of a modulo.
+	ShardCount uint64
+	// Hasher hashes a key to the uint64 used both to place it into a
+	// shard and as its key within that shard's map. Defaults to FNV-1a.
+	Hasher func(string) uint64
+	// MaxItems bounds the total number of items the cache will hold. It
+	// is enforced per-shard (MaxItems/ShardCount per shard), so the
+	// effective bound is approximate. Zero (the default) means
+	// unbounded.
+	MaxItems int
+	// Policy selects which item to evict once a shard is full. Ignored
+	// when MaxItems is zero. Defaults to PolicyLRU.
+	Policy EvictionPolicy
+}
+
+// EvictionPolicy selects which item a bounded cache discards once a shard
+// reaches MaxItems/ShardCount entries.
+type EvictionPolicy int
+
+const (
+	// PolicyLRU evicts the least recently used item (by Get/Set).
+	PolicyLRU EvictionPolicy = iota
+	// PolicyLFU evicts the least frequently used item (by access count).
+	PolicyLFU
+	// PolicyRandom evicts an arbitrary item.
+	PolicyRandom
+)
+
+// DefaultOptions returns the Options used by New(): 16 shards (the smallest
+// power of two at least as large as the previous hard-coded count of 10),
+// hashed with FNV-1a.
+func DefaultOptions() Options {
+	return Options{
+		ShardCount: 16,
+		Hasher:     calcHash,
+	}
+}
+
+// normalized fills in any zero-valued fields with their defaults and rounds
+// ShardCount up to the next power of two.
+func (o Options) normalized() Options {
+	if o.ShardCount == 0 {
+		o.ShardCount = 10
+	}
+	o.ShardCount = nextPowerOfTwo(o.ShardCount)
+	if o.Hasher == nil {
+		o.Hasher = calcHash
+	}
+	return o
+}
+
+func nextPowerOfTwo(n uint64) uint64 {
+	if n <= 1 {
+		return 1
+	}
+	n--
+	n |= n >> 1
+	n |= n >> 2
+	n |= n >> 4
+	n |= n >> 8
+	n |= n >> 16
+	n |= n >> 32
+	return n + 1
+}
+
+func newShardMap(opts Options) shardmap {
+	maxPerShard := 0
+	if opts.MaxItems > 0 {
+		maxPerShard = opts.MaxItems / int(opts.ShardCount)
+		if maxPerShard < 1 {
+			maxPerShard = 1
+		}
+	}
 
 	smap := shardmap{
-		shards:     make([]*lockMap, count),
-		shardCount: count,
+		shards:      make([]*lockMap, opts.ShardCount),
+		shardCount:  opts.ShardCount,
+		maxPerShard: maxPerShard,
+		policy:      opts.Policy,
 	}
 	for i, _ := range smap.shards {
-		smap.shards[i] = &lockMap{m: make(map[uint64]Item)}
+		sh := &lockMap{m: make(map[uint64]Item)}
+		if maxPerShard > 0 {
+			switch opts.Policy {
+			case PolicyLFU:
+				sh.freq = make(map[uint64]int64)
+			default:
+				sh.order = list.New()
+				sh.elems = make(map[uint64]*list.Element)
+			}
+		}
+		smap.shards[i] = sh
 	}
 	return smap
 }
@@ -71,7 +170,7 @@ func (item Item) expired() bool {
 }
 
 func (c *cache) GetShard(key uint64) *lockMap {
-	return c.shards.shards[key%c.shards.shardCount]
+	return c.shards.shards[key&(c.shards.shardCount-1)]
 }
 
 func calcHash(str string) uint64 {
@@ -80,6 +179,21 @@ func calcHash(str string) uint64 {
 	return hash.Sum64()
 }
 
+// SetOnEvicted sets an (optional) function that is called with the key and
+// value of an item when it is removed from the cache, whether by Delete,
+// DeleteExpired, or by being overwritten via Set/Replace. It is called
+// outside of the shard lock, so it is safe for f to call back into the
+// cache.
+func (c *cache) SetOnEvicted(f func(key string, value interface{})) {
+	c.onEvicted = f
+}
+
+func (c *cache) evict(item Item) {
+	if c.onEvicted != nil {
+		c.onEvicted(item.Key, item.Object)
+	}
+}
+
 // Add an item to the cache, replacing any existing item. If the duration is 0
 // (DefaultExpiration), the cache's default expiration time is used. If it is -1
 // (NoExpiration), the item never expires.
@@ -93,16 +207,28 @@ func (c *cache) Set(k string, x interface{}, d time.Duration) {
 		e = time.Now().Add(d).UnixNano()
 	}
 
-	key := calcHash(k)
+	key := c.options.Hasher(k)
 	shard := c.GetShard(key)
 	atomic.AddInt32(&c.Statistic.SetCount, 1)
 	atomic.AddInt32(&c.Statistic.ItemsCount, 1)
 	shard.Lock()
+	old, replaced := shard.m[key]
 	shard.m[key] = Item{
+		Key:        k,
 		Object:     x,
 		Expiration: e,
 	}
+	shard.touch(key)
+	evicted, didEvict := shard.evictOne(c.shards.maxPerShard, c.shards.policy)
 	shard.Unlock()
+
+	if replaced {
+		c.evict(old)
+	}
+	if didEvict {
+		atomic.AddInt32(&c.Statistic.ItemsCount, -1)
+		c.evict(evicted)
+	}
 }
 
 // Add an item to the cache only if an item doesn't already exist for the given
@@ -135,17 +261,42 @@ func (c *cache) Replace(k string, x interface{}, d time.Duration) error {
 // whether the key was found.
 func (c *cache) Get(k string) (interface{}, bool) {
 	// "Inlining" of get and expired
-	key := calcHash(k)
+	key := c.options.Hasher(k)
 	shard := c.GetShard(key)
-	shard.RLock()
-	item, found := shard.m[key]
-	shard.RUnlock()
+
+	var item Item
+	var found, expired bool
+	if c.shards.maxPerShard > 0 {
+		// A bounded cache needs to update LRU/LFU bookkeeping on every
+		// hit, which mutates shard state, so it must take the write lock.
+		shard.Lock()
+		item, found = shard.m[key]
+		if found {
+			if item.expired() {
+				expired = true
+				delete(shard.m, key)
+				shard.forget(key)
+			} else {
+				shard.touch(key)
+			}
+		}
+		shard.Unlock()
+	} else {
+		shard.RLock()
+		item, found = shard.m[key]
+		shard.RUnlock()
+		expired = found && item.expired()
+	}
 
 	if !found {
 		return nil, false
 	}
 
-	if item.expired() {
+	if expired {
+		if c.shards.maxPerShard > 0 {
+			atomic.AddInt32(&c.Statistic.ItemsCount, -1)
+			c.evict(item)
+		}
 		return nil, false
 	}
 
@@ -154,14 +305,21 @@ func (c *cache) Get(k string) (interface{}, bool) {
 }
 
 func (c *cache) Delete(k string) (interface{}, bool) {
-	key := calcHash(k)
+	key := c.options.Hasher(k)
 	shard := c.GetShard(key)
+
+	shard.Lock()
 	v, f := shard.m[key]
+	if f {
+		delete(shard.m, key)
+		shard.forget(key)
+	}
+	shard.Unlock()
 
 	if f {
 		atomic.AddInt32(&c.Statistic.ItemsCount, -1)
 		atomic.AddInt32(&c.Statistic.DeleteCount, 1)
-		delete(shard.m, key)
+		c.evict(v)
 		return v.Object, true
 	}
 	return nil, false
@@ -170,6 +328,7 @@ func (c *cache) Delete(k string) (interface{}, bool) {
 // Delete all expired items from the cache.
 func (c *cache) DeleteExpired() {
 	now := time.Now().UnixNano()
+	var evicted []Item
 	for i, _ := range c.shards.shards {
 		sh := c.shards.shards[i]
 		sh.Lock()
@@ -178,11 +337,16 @@ func (c *cache) DeleteExpired() {
 				atomic.AddInt32(&c.Statistic.DeleteExpired, 1)
 				atomic.AddInt32(&c.Statistic.ItemsCount, -1)
 				delete(sh.m, k)
+				sh.forget(k)
+				evicted = append(evicted, v)
 			}
 		}
 		sh.Unlock()
 	}
 
+	for _, v := range evicted {
+		c.evict(v)
+	}
 }
 
 // Returns the number of items in the cache. This may include items that have
@@ -199,7 +363,7 @@ func (c *cache) ItemCount() int { //TODO maybe get from statistics ?
 
 // Delete all items from the cache.
 func (c *cache) Flush() {
-	c.shards = newShardMap() //TODO init with params
+	c.shards = newShardMap(c.options)
 	c.Statistic.ItemsCount = 0
 }
 
@@ -234,19 +398,20 @@ func runJanitor(c *cache, ci time.Duration) {
 	go j.Run(c)
 }
 
-func newCache(de time.Duration) *cache {
+func newCache(de time.Duration, opts Options) *cache {
 	if de == 0 {
 		de = -1
 	}
 	c := &cache{
 		defaultExpiration: de,
-		shards:            newShardMap(),
+		options:           opts,
+		shards:            newShardMap(opts),
 	}
 	return c
 }
 
-func newCacheWithJanitor(de time.Duration, ci time.Duration) *Cache {
-	c := newCache(de)
+func newCacheWithJanitor(de time.Duration, ci time.Duration, opts Options) *Cache {
+	c := newCache(de, opts)
 	// This trick ensures that the janitor goroutine (which--granted it
 	// was enabled--is running DeleteExpired on c forever) does not keep
 	// the returned C object from being garbage collected. When it is
@@ -266,5 +431,12 @@ func newCacheWithJanitor(de time.Duration, ci time.Duration) *Cache {
 // manually. If the cleanup interval is less than one, expired items are not
 // deleted from the cache before calling c.DeleteExpired().
 func New(defaultExpiration, cleanupInterval time.Duration) *Cache {
-	return newCacheWithJanitor(defaultExpiration, cleanupInterval)
+	return newCacheWithJanitor(defaultExpiration, cleanupInterval, DefaultOptions().normalized())
+}
+
+// NewWithOptions is like New, but lets the caller configure the cache's
+// shard count and hash function via opts. Any zero-valued field in opts
+// falls back to its default (see DefaultOptions).
+func NewWithOptions(defaultExpiration, cleanupInterval time.Duration, opts Options) *Cache {
+	return newCacheWithJanitor(defaultExpiration, cleanupInterval, opts.normalized())
 }
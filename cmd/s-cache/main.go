@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	cache "github.com/Stive-11/s-cache"
+)
+
+const (
+	mode_http = "http"
+	mode_tcp  = "tcp"
+	mode_udp  = "udp"
+)
+
+type Config struct {
+	mode    string
+	address string
+
+	expiration int
+}
+
+func main() {
+	c := Config{}
+	c.initFlags()
+	cch := cache.New(time.Duration(c.expiration)*time.Second, time.Duration(c.expiration/10)*time.Second)
+	switch c.mode {
+	case mode_http:
+		err := http.ListenAndServe(c.address, nil)
+		if err != nil {
+			fmt.Printf("Error: %v", err)
+		}
+	case mode_tcp:
+		ln, err := net.Listen("tcp", c.address)
+		if err != nil {
+			log.Fatalln("Could not listen on: " + c.address)
+		}
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Println("Error accepting connection:", err)
+				continue
+			}
+			go cache.HandleConn(conn, cch)
+		}
+
+	case mode_udp:
+		udpAdd, err := net.ResolveUDPAddr("", c.address)
+		if err != nil {
+			log.Fatalln("Could not resolve address: " + c.address)
+		}
+		lnu, err := net.ListenUDP("udp", udpAdd)
+		if err != nil {
+			//TODO handle error
+		}
+		for {
+			buf := make([]byte, 8192) //TODO parametrize it 8k
+			_, _, err := lnu.ReadFromUDP(buf)
+			//TODO hande incoming message.
+
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+	default:
+		log.Fatalln("Not implemented mode: " + c.mode)
+	}
+}
+
+func (c *Config) initFlags() {
+	flag.StringVar(&c.mode, "http", "http", "mode of cachec server: can be "+mode_http+" "+mode_tcp+" or "+mode_udp)
+	flag.StringVar(&c.address, "bind", "", "optional options to set listening specific interface: <ip ro hostname>:<port>")
+	flag.IntVar(&c.expiration, "expiration", 200, "expiration time in seconds")
+	flag.Parse()
+
+	if err := c.checkFlags(); err != nil {
+		log.Println("Error:", err)
+		flag.PrintDefaults()
+	}
+}
+
+func (c *Config) checkFlags() error {
+	if c.mode != mode_http && c.mode != mode_tcp && c.mode != mode_udp {
+		return fmt.Errorf("Wrong mode: %s", c.mode)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+// touch updates the LRU/LFU bookkeeping for key after it has been read or
+// written. Callers must hold the shard's write lock.
+func (s *lockMap) touch(key uint64) {
+	switch {
+	case s.order != nil:
+		if elem, ok := s.elems[key]; ok {
+			s.order.MoveToFront(elem)
+		} else {
+			s.elems[key] = s.order.PushFront(key)
+		}
+	case s.freq != nil:
+		s.freq[key]++
+	}
+}
+
+// forget drops any LRU/LFU bookkeeping for key. Callers must hold the
+// shard's write lock.
+func (s *lockMap) forget(key uint64) {
+	if s.order != nil {
+		if elem, ok := s.elems[key]; ok {
+			s.order.Remove(elem)
+			delete(s.elems, key)
+		}
+	}
+	if s.freq != nil {
+		delete(s.freq, key)
+	}
+}
+
+// evictOne removes and returns one item from the shard according to policy,
+// if the shard holds more than max items. Callers must hold the shard's
+// write lock.
+func (s *lockMap) evictOne(max int, policy EvictionPolicy) (Item, bool) {
+	if max <= 0 || len(s.m) <= max {
+		return Item{}, false
+	}
+
+	switch policy {
+	case PolicyLFU:
+		var victim uint64
+		var minFreq int64
+		found := false
+		for k, f := range s.freq {
+			if !found || f < minFreq {
+				victim, minFreq, found = k, f, true
+			}
+		}
+		if !found {
+			return Item{}, false
+		}
+		item := s.m[victim]
+		delete(s.m, victim)
+		s.forget(victim)
+		return item, true
+
+	case PolicyRandom:
+		for k, item := range s.m {
+			delete(s.m, k)
+			s.forget(k)
+			return item, true
+		}
+		return Item{}, false
+
+	default: // PolicyLRU
+		elem := s.order.Back()
+		if elem == nil {
+			return Item{}, false
+		}
+		victim := elem.Value.(uint64)
+		item := s.m[victim]
+		delete(s.m, victim)
+		s.forget(victim)
+		return item, true
+	}
+}
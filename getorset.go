@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Increment increases the numeric value stored at k by delta and returns the
+// new value. The stored value must be an int, int32, int64 or uint; anything
+// else (including float32/float64, whose value an int64 result can't
+// represent), or a missing or expired key, returns an error.
+func (c *cache) Increment(k string, delta int64) (int64, error) {
+	return c.addDelta(k, delta)
+}
+
+// Decrement decreases the numeric value stored at k by delta and returns the
+// new value. See Increment for the supported types and error cases.
+func (c *cache) Decrement(k string, delta int64) (int64, error) {
+	return c.addDelta(k, -delta)
+}
+
+func (c *cache) addDelta(k string, delta int64) (int64, error) {
+	key := c.options.Hasher(k)
+	shard := c.GetShard(key)
+
+	shard.Lock()
+	defer shard.Unlock()
+
+	item, found := shard.m[key]
+	if !found || item.expired() {
+		return 0, fmt.Errorf("Item %s not found", k)
+	}
+
+	var result int64
+	switch v := item.Object.(type) {
+	case int:
+		v += int(delta)
+		item.Object, result = v, int64(v)
+	case int32:
+		v += int32(delta)
+		item.Object, result = v, int64(v)
+	case int64:
+		v += delta
+		item.Object, result = v, v
+	case uint:
+		v += uint(delta)
+		item.Object, result = v, int64(v)
+	case float32, float64:
+		return 0, fmt.Errorf("Item %s is a float, which Increment/Decrement's int64 result can't represent", k)
+	default:
+		return 0, fmt.Errorf("Item %s is not a numeric type", k)
+	}
+
+	shard.m[key] = item
+	shard.touch(key)
+	return result, nil
+}
+
+// call tracks a single in-flight GetOrSet loader call, so that concurrent
+// callers for the same key can wait on it instead of each invoking loader.
+type call struct {
+	wg    sync.WaitGroup
+	value interface{}
+	err   error
+}
+
+// GetOrSet returns the cached value for k, or calls loader to compute and
+// store it if the key is missing or has expired. Concurrent GetOrSet calls
+// for the same key share a single in-flight call to loader, which prevents
+// a thundering herd of loaders on a cache miss.
+func (c *cache) GetOrSet(k string, loader func() (interface{}, time.Duration, error)) (interface{}, error) {
+	if v, found := c.Get(k); found {
+		return v, nil
+	}
+
+	key := c.options.Hasher(k)
+	shard := c.GetShard(key)
+
+	shard.Lock()
+	if item, ok := shard.m[key]; ok && !item.expired() {
+		// Another GetOrSet finished loading k after our Get above missed.
+		shard.touch(key)
+		shard.Unlock()
+		return item.Object, nil
+	}
+	if inflight, ok := shard.calls[key]; ok {
+		shard.Unlock()
+		inflight.wg.Wait()
+		return inflight.value, inflight.err
+	}
+
+	cl := &call{}
+	cl.wg.Add(1)
+	if shard.calls == nil {
+		shard.calls = make(map[uint64]*call)
+	}
+	shard.calls[key] = cl
+	shard.Unlock()
+
+	value, d, err := loader()
+	if err == nil {
+		c.Set(k, value, d)
+	}
+	cl.value, cl.err = value, err
+	cl.wg.Done()
+
+	shard.Lock()
+	delete(shard.calls, key)
+	shard.Unlock()
+
+	return value, err
+}
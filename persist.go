@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"encoding/gob"
+	"io"
+	"os"
+	"time"
+)
+
+// Items returns a copy of all unexpired items in the cache, keyed by their
+// original string key.
+func (c *cache) Items() map[string]Item {
+	items := make(map[string]Item)
+	for _, sh := range c.shards.shards {
+		sh.RLock()
+		for _, item := range sh.m {
+			if !item.expired() {
+				items[item.Key] = item
+			}
+		}
+		sh.RUnlock()
+	}
+	return items
+}
+
+// Save writes the cache's items (minus those that have expired) to w as a
+// gob stream, so they can be restored later with Load. Object is encoded
+// through an interface{}, so any concrete type you store beyond the
+// built-ins gob already knows (numbers, strings, slices of those, ...; maps
+// are not among them) must be registered with gob.Register before calling
+// Save, the same as
+// any other gob-encoded interface value.
+func (c *cache) Save(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	return enc.Encode(c.Items())
+}
+
+// SaveFile saves the cache's items to the given file, creating it if it
+// doesn't exist, and overwriting it if it does.
+func (c *cache) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Save(f)
+}
+
+// Load adds all the items read from r, via a gob stream produced by Save,
+// to the cache. Any items with keys that already exist in the cache will be
+// overwritten. Expired items are skipped. Items are inserted through Set, so
+// a bounded cache's MaxItems/eviction policy and Statistic.ItemsCount stay
+// consistent, the same as if the items had been Set one by one.
+func (c *cache) Load(r io.Reader) error {
+	items := map[string]Item{}
+	dec := gob.NewDecoder(r)
+	if err := dec.Decode(&items); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.expired() {
+			continue
+		}
+		d := NoExpiration
+		if item.Expiration > 0 {
+			d = time.Duration(item.Expiration - time.Now().UnixNano())
+			if d <= 0 {
+				continue
+			}
+		}
+		c.Set(item.Key, item.Object, d)
+	}
+	return nil
+}
+
+// LoadFile loads items from the given file, as produced by SaveFile, into
+// the cache.
+func (c *cache) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Load(f)
+}
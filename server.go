@@ -1,106 +1,199 @@
 package cache
 
 import (
-	"flag"
+	"bufio"
+	"encoding/gob"
 	"fmt"
-	"log"
+	"io"
 	"net"
-	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
-const (
-	mode_http = "http"
-	mode_tcp  = "tcp"
-	mode_udp  = "udp"
-)
-
-type Config struct {
-	mode    string
-	address string
+// entry is what gets stored in the cache for values that arrive over the
+// memcached protocol, since the protocol carries flags alongside the data.
+type entry struct {
+	Flags uint32
+	Data  []byte
+}
 
-	expiration int
+func init() {
+	// Registered so that Save/Load (persist.go) can gob-encode items set
+	// through the memcached protocol, which always store an entry.
+	gob.Register(entry{})
 }
 
-func main() {
-	c := Config{}
-	c.initFlags()
-	cache := newCacheWithJanitor(time.Duration(c.expiration)*time.Second, time.Duration(c.expiration/10)*time.Second)
-	cache.Add("a", []byte("am"), 0) //TODO delete this line
-	switch c.mode {
-	case mode_http:
-		err := http.ListenAndServe(c.address, nil)
-		if err != nil {
-			fmt.Printf("Error: %v", err)
-		}
-	case mode_tcp:
-		ln, err := net.Listen("tcp", c.address)
+// HandleConn speaks a subset of the Memcached ASCII text protocol
+// (get, set, add, replace, delete, flush_all, stats) against cache, so that
+// existing memcached clients can talk to this process without modification.
+// It serves conn until the client disconnects or sends quit, and is meant
+// to be called once per accepted connection, typically in its own goroutine.
+func HandleConn(conn net.Conn, cache *Cache) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	defer writer.Flush()
+
+	for {
+		line, err := reader.ReadString('\n')
 		if err != nil {
-			//TODO handle error
-		}
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				//TODO handle error
+			if err != io.EOF {
+				fmt.Println("Error reading:", err.Error())
 			}
-			go handleTCPConnection(conn, cache)
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
 		}
 
-	case mode_udp:
-		udpAdd, err := net.ResolveUDPAddr("", c.address)
-		if err != nil {
-			log.Fatalln("Could not resolve address: " + c.address)
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
 		}
-		lnu, err := net.ListenUDP("udp", udpAdd)
-		if err != nil {
-			//TODO handle error
+		cmd := fields[0]
+
+		switch cmd {
+		case "get":
+			handleGet(writer, cache, fields[1:])
+		case "set":
+			handleStore(writer, reader, cache, fields[1:], storeSet)
+		case "add":
+			handleStore(writer, reader, cache, fields[1:], storeAdd)
+		case "replace":
+			handleStore(writer, reader, cache, fields[1:], storeReplace)
+		case "delete":
+			handleDelete(writer, cache, fields[1:])
+		case "flush_all":
+			handleFlushAll(writer, cache)
+		case "stats":
+			handleStats(writer, cache)
+		case "quit":
+			writer.Flush()
+			return
+		default:
+			writer.WriteString("ERROR\r\n")
 		}
-		for {
-			buf := make([]byte, 8192) //TODO parametrize it 8k
-			_, _, err := lnu.ReadFromUDP(buf)
-			//TODO hande incoming message.
+		writer.Flush()
+	}
+}
 
-			if err != nil {
-				log.Fatal(err)
-			}
+func handleGet(w *bufio.Writer, cache *Cache, keys []string) {
+	for _, key := range keys {
+		v, found := cache.Get(key)
+		if !found {
+			continue
+		}
+		e, ok := v.(entry)
+		if !ok {
+			continue
 		}
+		fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, e.Flags, len(e.Data))
+		w.Write(e.Data)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
 
-	default:
-		panic("Not implemented mode : " + c.mode)
+type storeMode int
+
+const (
+	storeSet storeMode = iota
+	storeAdd
+	storeReplace
+)
+
+// maxValueSize caps the <bytes> field of a set/add/replace command, to
+// reject bogus or hostile lengths (negative or absurdly large) before
+// allocating a buffer for them. Matches memcached's own default item cap.
+const maxValueSize = 1 << 20 // 1MiB
+
+// handleStore implements the shared "set <key> <flags> <exptime> <bytes>\r\n<data>\r\n"
+// wire format used by the set, add and replace commands.
+func handleStore(w *bufio.Writer, r *bufio.Reader, cache *Cache, args []string, mode storeMode) {
+	if len(args) < 4 {
+		w.WriteString("ERROR\r\n")
+		return
 	}
 
-}
+	key := args[0]
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.Atoi(args[2])
+	length, err3 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil || err3 != nil {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	if length < 0 || length > maxValueSize {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return
+	}
+
+	data := make([]byte, length+2) // +2 for the trailing \r\n
+	if _, err := io.ReadFull(r, data); err != nil {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	data = data[:length]
 
-func (c *Config) initFlags() {
-	flag.StringVar(&c.mode, "http", "http", "mode of cachec server: can be "+mode_http+" "+mode_tcp+" or "+mode_udp)
-	flag.StringVar(&c.address, "bind", "", "optional options to set listening specific interface: <ip ro hostname>:<port>")
-	flag.IntVar(&c.expiration, "expiration", 200, "expiration time in seconds")
-	flag.Parse()
+	e := entry{Flags: uint32(flags), Data: data}
+	d := expirationFromExptime(exptime)
 
-	if err := c.checkFlags(); err != nil {
-		fmt.Errorf("Error: %v", err)
-		flag.PrintDefaults()
+	var err error
+	switch mode {
+	case storeAdd:
+		err = cache.Add(key, e, d)
+	case storeReplace:
+		err = cache.Replace(key, e, d)
+	default:
+		cache.Set(key, e, d)
 	}
+
+	if err != nil {
+		w.WriteString("NOT_STORED\r\n")
+		return
+	}
+	w.WriteString("STORED\r\n")
 }
 
-func (c *Config) checkFlags() error {
-	if c.mode != mode_http || c.mode != mode_tcp || c.mode != mode_udp {
-		fmt.Errorf("Wrong mode: %s", c.mode)
+// expirationFromExptime maps the memcached exptime convention (0 means
+// never expire, positive values are seconds from now) onto a time.Duration
+// accepted by the cache.
+func expirationFromExptime(exptime int) time.Duration {
+	if exptime == 0 {
+		return NoExpiration
 	}
-	return nil
+	return time.Duration(exptime) * time.Second
 }
 
-//TODO rebuild to get set command
-func handleTCPConnection(conn net.Conn, cache *Cache) {
-	// Make a buffer to hold incoming data.
-	buf := make([]byte, 1024)
-	// Read the incoming connection into the buffer.
-	_, err := conn.Read(buf)
-	if err != nil {
-		fmt.Println("Error reading:", err.Error())
+func handleDelete(w *bufio.Writer, cache *Cache, args []string) {
+	if len(args) < 1 {
+		w.WriteString("ERROR\r\n")
+		return
 	}
-	// Send a response back to person contacting us.
-	conn.Write([]byte("Message received."))
-	// Close the connection when you're done with it.
-	conn.Close()
+	_, found := cache.Delete(args[0])
+	if !found {
+		w.WriteString("NOT_FOUND\r\n")
+		return
+	}
+	w.WriteString("DELETED\r\n")
+}
+
+func handleFlushAll(w *bufio.Writer, cache *Cache) {
+	cache.Flush()
+	w.WriteString("OK\r\n")
+}
+
+func handleStats(w *bufio.Writer, cache *Cache) {
+	s := cache.Statistic
+	fmt.Fprintf(w, "STAT items_count %d\r\n", s.ItemsCount)
+	fmt.Fprintf(w, "STAT get_count %d\r\n", s.GetCount)
+	fmt.Fprintf(w, "STAT set_count %d\r\n", s.SetCount)
+	fmt.Fprintf(w, "STAT replace_count %d\r\n", s.ReplaceCount)
+	fmt.Fprintf(w, "STAT delete_count %d\r\n", s.DeleteCount)
+	fmt.Fprintf(w, "STAT add_count %d\r\n", s.AddCount)
+	fmt.Fprintf(w, "STAT delete_expired %d\r\n", s.DeleteExpired)
+	w.WriteString("END\r\n")
 }